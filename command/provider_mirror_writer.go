@@ -0,0 +1,132 @@
+package command
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+)
+
+// MirrorWriter abstracts the storage destination for
+// "terraform providers mirror", so that the command can stage and commit
+// provider archives and write index files without caring whether the
+// mirror lives on local disk or in object storage.
+//
+// Implementations must make Commit appear atomic to anything reading the
+// mirror: a reader must never observe a partially-written artifact at
+// targetPath.
+type MirrorWriter interface {
+	// Open returns a reader for the content already committed at path, or
+	// an error for which errors.Is(err, fs.ErrNotExist) is true if
+	// nothing is there yet.
+	Open(path string) (io.ReadCloser, error)
+
+	// StageArtifact returns a writer for the staging copy of the artifact
+	// at path. The caller must Close it once fully written, and must not
+	// assume that path is visible to readers until Commit is called.
+	StageArtifact(path string) (io.WriteCloser, error)
+
+	// Commit makes the artifact previously staged at stagingPath visible
+	// at targetPath.
+	Commit(stagingPath, targetPath string) error
+
+	// Abort discards the staged artifact at stagingPath after a failed
+	// StageArtifact or Commit, so that a partial or orphaned staging copy
+	// is not left behind. It is safe to call even if nothing was ever
+	// successfully staged at stagingPath.
+	Abort(stagingPath string) error
+
+	// WriteIndex writes data to path, replacing any existing content.
+	// Index files are small enough to write directly rather than through
+	// the staging/commit sequence used for archives.
+	WriteIndex(path string, data []byte) error
+}
+
+// newMirrorWriter builds the MirrorWriter for the given <target-dir>
+// command-line argument. A bare path, or one with an explicit "file://"
+// scheme, is written to local disk as before; "s3://", "gs://", and
+// "azblob://" URLs are written to the corresponding object storage
+// service.
+func newMirrorWriter(target string) (MirrorWriter, error) {
+	u, err := url.Parse(target)
+	if err == nil && u.Scheme == "file" {
+		return newLocalMirrorWriter(filepath.FromSlash(u.Path)), nil
+	}
+	if err != nil || u.Scheme == "" || isWindowsDriveLetter(u.Scheme) {
+		return newLocalMirrorWriter(target), nil
+	}
+
+	switch u.Scheme {
+	case "s3":
+		return newS3MirrorWriter(u)
+	case "gs":
+		return newGCSMirrorWriter(u)
+	case "azblob":
+		return newAzureBlobMirrorWriter(u)
+	default:
+		return nil, fmt.Errorf("unsupported mirror target scheme %q (must be one of s3, gs, azblob, or a local path)", u.Scheme)
+	}
+}
+
+// isWindowsDriveLetter returns true if scheme is a single letter, as
+// url.Parse reports for a Windows absolute path like `C:\mirror` or
+// `C:/mirror`: the drive letter is indistinguishable from a URL scheme to
+// the parser, so without this check those paths would be misidentified as
+// an unsupported object storage scheme instead of a local path.
+func isWindowsDriveLetter(scheme string) bool {
+	if len(scheme) != 1 {
+		return false
+	}
+	c := scheme[0]
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// localMirrorWriter is the MirrorWriter for a plain directory on local
+// disk, which was the only supported target before object storage
+// support was added.
+type localMirrorWriter struct {
+	root string
+}
+
+func newLocalMirrorWriter(root string) *localMirrorWriter {
+	return &localMirrorWriter{root: root}
+}
+
+func (w *localMirrorWriter) abs(path string) string {
+	return filepath.Join(w.root, path)
+}
+
+func (w *localMirrorWriter) Open(path string) (io.ReadCloser, error) {
+	return os.Open(w.abs(path))
+}
+
+func (w *localMirrorWriter) StageArtifact(path string) (io.WriteCloser, error) {
+	full := w.abs(path)
+	if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+		return nil, err
+	}
+	// Clean up any stale staging file left behind by a previous,
+	// interrupted run before we start writing a new one.
+	os.Remove(full)
+	return os.Create(full)
+}
+
+func (w *localMirrorWriter) Commit(stagingPath, targetPath string) error {
+	return os.Rename(w.abs(stagingPath), w.abs(targetPath))
+}
+
+func (w *localMirrorWriter) Abort(stagingPath string) error {
+	if err := os.Remove(w.abs(stagingPath)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (w *localMirrorWriter) WriteIndex(path string, data []byte) error {
+	full := w.abs(path)
+	if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(full, data, 0644)
+}
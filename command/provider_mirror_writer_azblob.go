@@ -0,0 +1,223 @@
+package command
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-storage-blob-go/azblob"
+)
+
+// azureBlobMirrorWriter is the MirrorWriter for an
+// "azblob://container/prefix" target. Archives are uploaded under a
+// ".staging/" blob prefix and promoted into place with
+// StartCopyFromURL, polling until the service-side copy completes,
+// mirroring the staging/commit pattern used for S3 and GCS.
+//
+// The storage account is taken from the AZURE_STORAGE_ACCOUNT
+// environment variable, with its key from AZURE_STORAGE_KEY, and that's
+// the only authentication this writer supports. This is much narrower
+// than Terraform's own azurerm backend, which also supports service
+// principal, managed identity, and Azure CLI authentication; none of
+// that is available here, so a mirror target that needs it isn't
+// currently usable.
+type azureBlobMirrorWriter struct {
+	store  azureBlobStore
+	prefix string
+}
+
+// azureBlobStore is the subset of operations on an azblob.ContainerURL
+// that azureBlobMirrorWriter depends on, keyed by blob name rather than
+// exposing azblob.BlockBlobURL directly, so that tests can exercise its
+// staging/commit/abort logic against a fake instead of a real storage
+// account.
+type azureBlobStore interface {
+	NewReader(ctx context.Context, key string) (io.ReadCloser, error)
+	Upload(ctx context.Context, key string, data []byte) error
+	Copy(ctx context.Context, srcKey, dstKey string) error
+	Delete(ctx context.Context, key string) error
+}
+
+// azureContainerStore is the azureBlobStore backed by a real
+// azblob.ContainerURL.
+type azureContainerStore struct {
+	container azblob.ContainerURL
+}
+
+func (s *azureContainerStore) blobURL(key string) azblob.BlockBlobURL {
+	return s.container.NewBlockBlobURL(key)
+}
+
+func (s *azureContainerStore) NewReader(ctx context.Context, key string) (io.ReadCloser, error) {
+	resp, err := s.blobURL(key).Download(ctx, 0, azblob.CountToEnd, azblob.BlobAccessConditions{}, false, azblob.ClientProvidedKeyOptions{})
+	if err != nil {
+		if isAzureBlobNotFound(err) {
+			return nil, fmt.Errorf("%w: %s", fs.ErrNotExist, err)
+		}
+		return nil, err
+	}
+	return resp.Body(azblob.RetryReaderOptions{}), nil
+}
+
+func (s *azureContainerStore) Upload(ctx context.Context, key string, data []byte) error {
+	_, err := azblob.UploadBufferToBlockBlob(ctx, data, s.blobURL(key), azblob.UploadToBlockBlobOptions{})
+	return err
+}
+
+func (s *azureContainerStore) Copy(ctx context.Context, srcKey, dstKey string) error {
+	src := s.blobURL(srcKey)
+	dst := s.blobURL(dstKey)
+
+	resp, err := dst.StartCopyFromURL(ctx, src.URL(), nil, azblob.ModifiedAccessConditions{}, azblob.BlobAccessConditions{}, azblob.DefaultAccessTier, nil)
+	if err != nil {
+		return err
+	}
+
+	status, description, err := awaitAzureCopyStatus(resp.CopyStatus(), func() (azblob.CopyStatusType, string, error) {
+		props, err := dst.GetProperties(ctx, azblob.BlobAccessConditions{}, azblob.ClientProvidedKeyOptions{})
+		if err != nil {
+			return "", "", err
+		}
+		return props.CopyStatus(), props.CopyStatusDescription(), nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to poll copy status: %w", err)
+	}
+	if status != azblob.CopyStatusSuccess {
+		return fmt.Errorf("status %s (%s)", status, description)
+	}
+	return nil
+}
+
+func (s *azureContainerStore) Delete(ctx context.Context, key string) error {
+	_, err := s.blobURL(key).Delete(ctx, azblob.DeleteSnapshotsOptionNone, azblob.BlobAccessConditions{})
+	if isAzureBlobNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// isAzureBlobNotFound reports whether err is the Azure Blob Storage
+// service's response to an operation against a blob that doesn't exist.
+func isAzureBlobNotFound(err error) bool {
+	stgErr, ok := err.(azblob.StorageError)
+	return ok && stgErr.ServiceCode() == azblob.ServiceCodeBlobNotFound
+}
+
+func newAzureBlobMirrorWriter(u *url.URL) (*azureBlobMirrorWriter, error) {
+	account := os.Getenv("AZURE_STORAGE_ACCOUNT")
+	key := os.Getenv("AZURE_STORAGE_KEY")
+	if account == "" || key == "" {
+		return nil, fmt.Errorf("AZURE_STORAGE_ACCOUNT and AZURE_STORAGE_KEY must be set to mirror to an azblob:// target")
+	}
+	cred, err := azblob.NewSharedKeyCredential(account, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure Azure storage credentials: %w", err)
+	}
+	pipeline := azblob.NewPipeline(cred, azblob.PipelineOptions{})
+	serviceURL, err := url.Parse(fmt.Sprintf("https://%s.blob.core.windows.net", account))
+	if err != nil {
+		return nil, err
+	}
+	containerURL := azblob.NewServiceURL(*serviceURL, pipeline).NewContainerURL(u.Host)
+	return &azureBlobMirrorWriter{
+		store:  &azureContainerStore{container: containerURL},
+		prefix: strings.Trim(u.Path, "/"),
+	}, nil
+}
+
+func (w *azureBlobMirrorWriter) key(p string) string {
+	return path.Join(w.prefix, p)
+}
+
+func (w *azureBlobMirrorWriter) stagingKey(p string) string {
+	return path.Join(w.prefix, ".staging", p)
+}
+
+func (w *azureBlobMirrorWriter) Open(p string) (io.ReadCloser, error) {
+	r, err := w.store.NewReader(context.Background(), w.key(p))
+	if err != nil {
+		if isAzureBlobNotFound(err) {
+			return nil, fmt.Errorf("%w: %s", fs.ErrNotExist, err)
+		}
+		return nil, err
+	}
+	return r, nil
+}
+
+func (w *azureBlobMirrorWriter) StageArtifact(p string) (io.WriteCloser, error) {
+	return &azureStagingWriter{store: w.store, key: w.stagingKey(p)}, nil
+}
+
+func (w *azureBlobMirrorWriter) Commit(stagingPath, targetPath string) error {
+	ctx := context.Background()
+	srcKey := w.stagingKey(stagingPath)
+	dstKey := w.key(targetPath)
+
+	if err := w.store.Copy(ctx, srcKey, dstKey); err != nil {
+		// We don't delete the source staging blob here: a reader must
+		// never observe targetPath without it having actually been
+		// written there, so we only remove the staging copy once we
+		// know the destination is good. Cleaning up the now-unneeded
+		// staging blob after a failed commit is the caller's job
+		// (stageAndCommit calls Abort in its deferred cleanup), not
+		// this method's.
+		return fmt.Errorf("failed to promote %s to %s: %w", stagingPath, targetPath, err)
+	}
+
+	return w.store.Delete(ctx, srcKey)
+}
+
+// awaitAzureCopyStatus polls poll until the service-side copy it reports on
+// leaves azblob.CopyStatusPending, starting from the status already
+// returned by StartCopyFromURL, and returns the terminal status and its
+// description. It's split out from azureContainerStore.Copy so that the
+// polling and terminal-status handling can be tested without a real
+// storage account.
+func awaitAzureCopyStatus(initial azblob.CopyStatusType, poll func() (azblob.CopyStatusType, string, error)) (azblob.CopyStatusType, string, error) {
+	status := initial
+	var description string
+	for status == azblob.CopyStatusPending {
+		time.Sleep(time.Second)
+		polledStatus, polledDescription, err := poll()
+		if err != nil {
+			return "", "", err
+		}
+		status = polledStatus
+		description = polledDescription
+	}
+	return status, description, nil
+}
+
+// Abort deletes the staged blob, if any.
+func (w *azureBlobMirrorWriter) Abort(stagingPath string) error {
+	return w.store.Delete(context.Background(), w.stagingKey(stagingPath))
+}
+
+func (w *azureBlobMirrorWriter) WriteIndex(p string, data []byte) error {
+	return w.store.Upload(context.Background(), w.key(p), data)
+}
+
+// azureStagingWriter buffers a staged artifact in memory and uploads it
+// as a single block blob when closed, since the block blob API has no
+// append-then-finalize write primitive analogous to a local file handle.
+type azureStagingWriter struct {
+	store azureBlobStore
+	key   string
+	buf   bytes.Buffer
+}
+
+func (s *azureStagingWriter) Write(p []byte) (int, error) {
+	return s.buf.Write(p)
+}
+
+func (s *azureStagingWriter) Close() error {
+	return s.store.Upload(context.Background(), s.key, s.buf.Bytes())
+}
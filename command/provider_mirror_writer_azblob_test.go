@@ -0,0 +1,228 @@
+package command
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"testing"
+
+	"github.com/Azure/azure-storage-blob-go/azblob"
+)
+
+// fakeAzureStorageError is a minimal azblob.StorageError implementation,
+// since the real type is unexported, used to simulate the service's
+// "blob not found" response without a real storage account.
+type fakeAzureStorageError struct {
+	serviceCode azblob.ServiceCodeType
+}
+
+func (e *fakeAzureStorageError) Error() string                       { return string(e.serviceCode) }
+func (e *fakeAzureStorageError) Timeout() bool                       { return false }
+func (e *fakeAzureStorageError) Temporary() bool                     { return false }
+func (e *fakeAzureStorageError) ServiceCode() azblob.ServiceCodeType { return e.serviceCode }
+func (e *fakeAzureStorageError) Response() *http.Response            { return nil }
+
+// fakeAzureBlobStore is a minimal in-memory stand-in for azureBlobStore,
+// keyed by blob name, used to exercise azureBlobMirrorWriter's
+// staging/commit/abort logic without a real storage account.
+type fakeAzureBlobStore struct {
+	blobs   map[string][]byte
+	copyErr error
+}
+
+func (f *fakeAzureBlobStore) NewReader(ctx context.Context, key string) (io.ReadCloser, error) {
+	data, ok := f.blobs[key]
+	if !ok {
+		return nil, &fakeAzureStorageError{serviceCode: azblob.ServiceCodeBlobNotFound}
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (f *fakeAzureBlobStore) Upload(ctx context.Context, key string, data []byte) error {
+	if f.blobs == nil {
+		f.blobs = make(map[string][]byte)
+	}
+	f.blobs[key] = data
+	return nil
+}
+
+func (f *fakeAzureBlobStore) Copy(ctx context.Context, srcKey, dstKey string) error {
+	if f.copyErr != nil {
+		return f.copyErr
+	}
+	data, ok := f.blobs[srcKey]
+	if !ok {
+		return &fakeAzureStorageError{serviceCode: azblob.ServiceCodeBlobNotFound}
+	}
+	if f.blobs == nil {
+		f.blobs = make(map[string][]byte)
+	}
+	f.blobs[dstKey] = data
+	return nil
+}
+
+func (f *fakeAzureBlobStore) Delete(ctx context.Context, key string) error {
+	if _, ok := f.blobs[key]; !ok {
+		return nil
+	}
+	delete(f.blobs, key)
+	return nil
+}
+
+func TestAzureBlobMirrorWriter_OpenNotFound(t *testing.T) {
+	store := &fakeAzureBlobStore{blobs: make(map[string][]byte)}
+	w := &azureBlobMirrorWriter{store: store, prefix: "mirror"}
+
+	_, err := w.Open("example.com/ns/type/1.0.0.json")
+	if err == nil {
+		t.Fatal("expected an error opening a blob that doesn't exist")
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("errors.Is(err, fs.ErrNotExist) = false for %v; want true", err)
+	}
+}
+
+func TestAzureBlobMirrorWriter_StageCommit(t *testing.T) {
+	store := &fakeAzureBlobStore{blobs: make(map[string][]byte)}
+	w := &azureBlobMirrorWriter{store: store, prefix: "mirror"}
+	const stagingPath = ".example.zip"
+
+	staged, err := w.StageArtifact(stagingPath)
+	if err != nil {
+		t.Fatalf("StageArtifact: %s", err)
+	}
+	if _, err := staged.Write([]byte("package contents")); err != nil {
+		t.Fatalf("write: %s", err)
+	}
+	if err := staged.Close(); err != nil {
+		t.Fatalf("close: %s", err)
+	}
+
+	if err := w.Commit(stagingPath, "example.zip"); err != nil {
+		t.Fatalf("Commit: %s", err)
+	}
+
+	if _, ok := store.blobs[w.stagingKey(stagingPath)]; ok {
+		t.Error("staging blob was not deleted after a successful commit")
+	}
+	data, ok := store.blobs[w.key("example.zip")]
+	if !ok || string(data) != "package contents" {
+		t.Errorf("target blob = %q, %v; want %q, true", data, ok, "package contents")
+	}
+}
+
+func TestAzureBlobMirrorWriter_CommitFailsIfCopyFails(t *testing.T) {
+	const stagingPath = ".example.zip"
+	w := &azureBlobMirrorWriter{prefix: "mirror"}
+	store := &fakeAzureBlobStore{
+		blobs:   map[string][]byte{w.stagingKey(stagingPath): []byte("partial")},
+		copyErr: errors.New("quota exceeded"),
+	}
+	w.store = store
+
+	err := w.Commit(stagingPath, "example.zip")
+	if err == nil {
+		t.Fatal("expected an error when the server-side copy fails")
+	}
+	if _, ok := store.blobs[w.key("example.zip")]; ok {
+		t.Error("target blob should not exist after a failed copy")
+	}
+	if _, ok := store.blobs[w.stagingKey(stagingPath)]; !ok {
+		t.Error("staging blob should be left in place by Commit after a failed copy, not deleted")
+	}
+}
+
+func TestAzureBlobMirrorWriter_Abort(t *testing.T) {
+	const stagingPath = ".example.zip"
+	w := &azureBlobMirrorWriter{prefix: "mirror"}
+	store := &fakeAzureBlobStore{blobs: map[string][]byte{
+		w.stagingKey(stagingPath): []byte("partial"),
+	}}
+	w.store = store
+
+	if err := w.Abort(stagingPath); err != nil {
+		t.Fatalf("Abort: %s", err)
+	}
+	if _, ok := store.blobs[w.stagingKey(stagingPath)]; ok {
+		t.Error("staged blob was not removed by Abort")
+	}
+}
+
+func TestAwaitAzureCopyStatus(t *testing.T) {
+	t.Run("already succeeded", func(t *testing.T) {
+		polled := false
+		status, _, err := awaitAzureCopyStatus(azblob.CopyStatusSuccess, func() (azblob.CopyStatusType, string, error) {
+			polled = true
+			return "", "", nil
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if status != azblob.CopyStatusSuccess {
+			t.Errorf("status = %s; want %s", status, azblob.CopyStatusSuccess)
+		}
+		if polled {
+			t.Error("poll was called even though the initial status was already terminal")
+		}
+	})
+
+	t.Run("pending then success", func(t *testing.T) {
+		calls := 0
+		status, _, err := awaitAzureCopyStatus(azblob.CopyStatusPending, func() (azblob.CopyStatusType, string, error) {
+			calls++
+			if calls < 2 {
+				return azblob.CopyStatusPending, "", nil
+			}
+			return azblob.CopyStatusSuccess, "", nil
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if status != azblob.CopyStatusSuccess {
+			t.Errorf("status = %s; want %s", status, azblob.CopyStatusSuccess)
+		}
+		if calls != 2 {
+			t.Errorf("poll was called %d times; want 2", calls)
+		}
+	})
+
+	t.Run("terminal failure", func(t *testing.T) {
+		status, description, err := awaitAzureCopyStatus(azblob.CopyStatusPending, func() (azblob.CopyStatusType, string, error) {
+			return azblob.CopyStatusFailed, "quota exceeded", nil
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if status != azblob.CopyStatusFailed {
+			t.Errorf("status = %s; want %s", status, azblob.CopyStatusFailed)
+		}
+		if description != "quota exceeded" {
+			t.Errorf("description = %q; want %q", description, "quota exceeded")
+		}
+	})
+
+	t.Run("terminal aborted", func(t *testing.T) {
+		status, _, err := awaitAzureCopyStatus(azblob.CopyStatusPending, func() (azblob.CopyStatusType, string, error) {
+			return azblob.CopyStatusAborted, "", nil
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if status != azblob.CopyStatusAborted {
+			t.Errorf("status = %s; want %s", status, azblob.CopyStatusAborted)
+		}
+	})
+
+	t.Run("poll error", func(t *testing.T) {
+		wantErr := errors.New("transient network error")
+		_, _, err := awaitAzureCopyStatus(azblob.CopyStatusPending, func() (azblob.CopyStatusType, string, error) {
+			return "", "", wantErr
+		})
+		if !errors.Is(err, wantErr) {
+			t.Errorf("err = %v; want %v", err, wantErr)
+		}
+	})
+}
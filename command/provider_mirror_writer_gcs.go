@@ -0,0 +1,133 @@
+package command
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"path"
+	"strings"
+
+	"cloud.google.com/go/storage"
+)
+
+// gcsMirrorWriter is the MirrorWriter for a "gs://bucket/prefix" target.
+// Like s3MirrorWriter, archives are uploaded under a ".staging/" object
+// prefix and promoted into place with a server-side copy so that readers
+// never see a partially-uploaded object at its final name.
+//
+// Credentials are resolved with storage.NewClient's own default behavior,
+// which looks for Application Default Credentials (the environment
+// variable, gcloud user credentials, or the metadata server). This is
+// independent of, and narrower than, Terraform's own gcs backend, which
+// also accepts an explicit credentials file or JSON blob, impersonation,
+// and other provider-level options; none of those are wired in here.
+type gcsMirrorWriter struct {
+	store  gcsObjectStore
+	prefix string
+}
+
+// gcsObjectStore is the subset of operations on a *storage.Client's bucket
+// that gcsMirrorWriter depends on, so that tests can exercise its
+// staging/commit/abort logic against a fake instead of a real bucket.
+type gcsObjectStore interface {
+	NewReader(ctx context.Context, key string) (io.ReadCloser, error)
+	NewWriter(ctx context.Context, key, contentType string) io.WriteCloser
+	Copy(ctx context.Context, srcKey, dstKey string) error
+	Delete(ctx context.Context, key string) error
+}
+
+// gcsClientStore is the gcsObjectStore backed by a real *storage.Client.
+type gcsClientStore struct {
+	client *storage.Client
+	bucket string
+}
+
+func (s *gcsClientStore) object(key string) *storage.ObjectHandle {
+	return s.client.Bucket(s.bucket).Object(key)
+}
+
+func (s *gcsClientStore) NewReader(ctx context.Context, key string) (io.ReadCloser, error) {
+	return s.object(key).NewReader(ctx)
+}
+
+func (s *gcsClientStore) NewWriter(ctx context.Context, key, contentType string) io.WriteCloser {
+	w := s.object(key).NewWriter(ctx)
+	if contentType != "" {
+		w.ContentType = contentType
+	}
+	return w
+}
+
+func (s *gcsClientStore) Copy(ctx context.Context, srcKey, dstKey string) error {
+	_, err := s.object(dstKey).CopierFrom(s.object(srcKey)).Run(ctx)
+	return err
+}
+
+func (s *gcsClientStore) Delete(ctx context.Context, key string) error {
+	return s.object(key).Delete(ctx)
+}
+
+func newGCSMirrorWriter(u *url.URL) (*gcsMirrorWriter, error) {
+	client, err := storage.NewClient(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure the Google Cloud Storage client: %w", err)
+	}
+	return &gcsMirrorWriter{
+		store:  &gcsClientStore{client: client, bucket: u.Host},
+		prefix: strings.Trim(u.Path, "/"),
+	}, nil
+}
+
+func (w *gcsMirrorWriter) key(p string) string {
+	return path.Join(w.prefix, p)
+}
+
+func (w *gcsMirrorWriter) stagingKey(p string) string {
+	return path.Join(w.prefix, ".staging", p)
+}
+
+func (w *gcsMirrorWriter) Open(p string) (io.ReadCloser, error) {
+	r, err := w.store.NewReader(context.Background(), w.key(p))
+	if err != nil {
+		if errors.Is(err, storage.ErrObjectNotExist) {
+			return nil, fmt.Errorf("%w: %s", fs.ErrNotExist, err)
+		}
+		return nil, err
+	}
+	return r, nil
+}
+
+func (w *gcsMirrorWriter) StageArtifact(p string) (io.WriteCloser, error) {
+	return w.store.NewWriter(context.Background(), w.stagingKey(p), ""), nil
+}
+
+func (w *gcsMirrorWriter) Commit(stagingPath, targetPath string) error {
+	ctx := context.Background()
+	srcKey := w.stagingKey(stagingPath)
+	dstKey := w.key(targetPath)
+	if err := w.store.Copy(ctx, srcKey, dstKey); err != nil {
+		return fmt.Errorf("failed to promote %s to %s: %w", stagingPath, targetPath, err)
+	}
+	return w.store.Delete(ctx, srcKey)
+}
+
+// Abort deletes the staged object, if any.
+func (w *gcsMirrorWriter) Abort(stagingPath string) error {
+	err := w.store.Delete(context.Background(), w.stagingKey(stagingPath))
+	if err == storage.ErrObjectNotExist {
+		return nil
+	}
+	return err
+}
+
+func (w *gcsMirrorWriter) WriteIndex(p string, data []byte) error {
+	writer := w.store.NewWriter(context.Background(), w.key(p), "application/json")
+	if _, err := writer.Write(data); err != nil {
+		writer.Close()
+		return err
+	}
+	return writer.Close()
+}
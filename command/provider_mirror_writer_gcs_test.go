@@ -0,0 +1,159 @@
+package command
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"testing"
+
+	"cloud.google.com/go/storage"
+)
+
+// fakeGCSObjectStore is a minimal in-memory stand-in for gcsObjectStore,
+// keyed by object key, used to exercise gcsMirrorWriter's
+// staging/commit/abort logic without a real bucket.
+type fakeGCSObjectStore struct {
+	objects map[string][]byte
+	copyErr error
+}
+
+func (f *fakeGCSObjectStore) NewReader(ctx context.Context, key string) (io.ReadCloser, error) {
+	data, ok := f.objects[key]
+	if !ok {
+		return nil, storage.ErrObjectNotExist
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+type fakeGCSWriter struct {
+	store *fakeGCSObjectStore
+	key   string
+	buf   bytes.Buffer
+}
+
+func (w *fakeGCSWriter) Write(p []byte) (int, error) { return w.buf.Write(p) }
+
+func (w *fakeGCSWriter) Close() error {
+	if w.store.objects == nil {
+		w.store.objects = make(map[string][]byte)
+	}
+	w.store.objects[w.key] = w.buf.Bytes()
+	return nil
+}
+
+func (f *fakeGCSObjectStore) NewWriter(ctx context.Context, key, contentType string) io.WriteCloser {
+	return &fakeGCSWriter{store: f, key: key}
+}
+
+func (f *fakeGCSObjectStore) Copy(ctx context.Context, srcKey, dstKey string) error {
+	if f.copyErr != nil {
+		return f.copyErr
+	}
+	data, ok := f.objects[srcKey]
+	if !ok {
+		return storage.ErrObjectNotExist
+	}
+	if f.objects == nil {
+		f.objects = make(map[string][]byte)
+	}
+	f.objects[dstKey] = data
+	return nil
+}
+
+func (f *fakeGCSObjectStore) Delete(ctx context.Context, key string) error {
+	if _, ok := f.objects[key]; !ok {
+		return storage.ErrObjectNotExist
+	}
+	delete(f.objects, key)
+	return nil
+}
+
+func TestGCSMirrorWriter_OpenNotFound(t *testing.T) {
+	store := &fakeGCSObjectStore{objects: make(map[string][]byte)}
+	w := &gcsMirrorWriter{store: store, prefix: "mirror"}
+
+	_, err := w.Open("example.com/ns/type/1.0.0.json")
+	if err == nil {
+		t.Fatal("expected an error opening an object that doesn't exist")
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("errors.Is(err, fs.ErrNotExist) = false for %v; want true", err)
+	}
+}
+
+func TestGCSMirrorWriter_StageCommit(t *testing.T) {
+	store := &fakeGCSObjectStore{objects: make(map[string][]byte)}
+	w := &gcsMirrorWriter{store: store, prefix: "mirror"}
+	const stagingPath = ".example.zip"
+
+	staged, err := w.StageArtifact(stagingPath)
+	if err != nil {
+		t.Fatalf("StageArtifact: %s", err)
+	}
+	if _, err := staged.Write([]byte("package contents")); err != nil {
+		t.Fatalf("write: %s", err)
+	}
+	if err := staged.Close(); err != nil {
+		t.Fatalf("close: %s", err)
+	}
+
+	if err := w.Commit(stagingPath, "example.zip"); err != nil {
+		t.Fatalf("Commit: %s", err)
+	}
+
+	if _, ok := store.objects[w.stagingKey(stagingPath)]; ok {
+		t.Error("staged object was not deleted after a successful commit")
+	}
+	data, ok := store.objects[w.key("example.zip")]
+	if !ok || string(data) != "package contents" {
+		t.Errorf("target object = %q, %v; want %q, true", data, ok, "package contents")
+	}
+}
+
+func TestGCSMirrorWriter_CommitFailsIfCopyFails(t *testing.T) {
+	const stagingPath = ".example.zip"
+	w := &gcsMirrorWriter{prefix: "mirror"}
+	store := &fakeGCSObjectStore{
+		objects: map[string][]byte{w.stagingKey(stagingPath): []byte("partial")},
+		copyErr: errors.New("permission denied"),
+	}
+	w.store = store
+
+	err := w.Commit(stagingPath, "example.zip")
+	if err == nil {
+		t.Fatal("expected an error when the server-side copy fails")
+	}
+	if _, ok := store.objects[w.key("example.zip")]; ok {
+		t.Error("target object should not exist after a failed copy")
+	}
+	if _, ok := store.objects[w.stagingKey(stagingPath)]; !ok {
+		t.Error("staging object should be left in place after a failed copy, not deleted")
+	}
+}
+
+func TestGCSMirrorWriter_Abort(t *testing.T) {
+	const stagingPath = ".example.zip"
+	w := &gcsMirrorWriter{prefix: "mirror"}
+	store := &fakeGCSObjectStore{objects: map[string][]byte{
+		w.stagingKey(stagingPath): []byte("partial"),
+	}}
+	w.store = store
+
+	if err := w.Abort(stagingPath); err != nil {
+		t.Fatalf("Abort: %s", err)
+	}
+	if _, ok := store.objects[w.stagingKey(stagingPath)]; ok {
+		t.Error("staged object was not removed by Abort")
+	}
+}
+
+func TestGCSMirrorWriter_AbortIsNoopWhenNothingStaged(t *testing.T) {
+	store := &fakeGCSObjectStore{objects: make(map[string][]byte)}
+	w := &gcsMirrorWriter{store: store, prefix: "mirror"}
+
+	if err := w.Abort(".example.zip"); err != nil {
+		t.Fatalf("Abort of a never-staged artifact should be a no-op, got: %s", err)
+	}
+}
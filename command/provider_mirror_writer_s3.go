@@ -0,0 +1,166 @@
+package command
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	awsbase "github.com/hashicorp/aws-sdk-go-base/v2"
+)
+
+// s3MirrorWriter is the MirrorWriter for an "s3://bucket/prefix" target.
+// Archives are uploaded to a ".staging/" key prefix and promoted into
+// place with a server-side copy, so that a reader polling the bucket
+// never sees a partially-uploaded object at its final key.
+//
+// Credentials are resolved with aws-sdk-go-base, the same library the S3
+// remote-state backend uses to build its AWS SDK configuration, so
+// mirroring picks up the same environment variables, shared
+// config/credentials files, assumed roles, and container/instance role
+// credentials the backend does, without needing a second set of AWS
+// configuration just for mirroring. Unlike the backend, this writer has no
+// schema of its own to carry explicit per-target overrides (profile,
+// assume_role, and so on): those still have to come from the shared
+// environment or config files rather than the mirror target URL.
+type s3MirrorWriter struct {
+	client s3API
+	bucket string
+	prefix string
+}
+
+// s3API is the subset of *s3.Client that s3MirrorWriter depends on, so that
+// tests can exercise its staging/commit/abort logic against a fake instead
+// of a real bucket.
+type s3API interface {
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+	PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+	CopyObject(ctx context.Context, params *s3.CopyObjectInput, optFns ...func(*s3.Options)) (*s3.CopyObjectOutput, error)
+	DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error)
+	GetObjectAttributes(ctx context.Context, params *s3.GetObjectAttributesInput, optFns ...func(*s3.Options)) (*s3.GetObjectAttributesOutput, error)
+}
+
+func newS3MirrorWriter(u *url.URL) (*s3MirrorWriter, error) {
+	ctx := context.Background()
+	cfg, diags := awsbase.GetAwsConfig(ctx, &awsbase.Config{})
+	if diags.HasError() {
+		return nil, fmt.Errorf("failed to configure AWS credentials: %s", diags)
+	}
+	return &s3MirrorWriter{
+		client: s3.NewFromConfig(cfg),
+		bucket: u.Host,
+		prefix: strings.Trim(u.Path, "/"),
+	}, nil
+}
+
+func (w *s3MirrorWriter) key(p string) string {
+	return path.Join(w.prefix, p)
+}
+
+func (w *s3MirrorWriter) stagingKey(p string) string {
+	return path.Join(w.prefix, ".staging", p)
+}
+
+func (w *s3MirrorWriter) Open(p string) (io.ReadCloser, error) {
+	out, err := w.client.GetObject(context.Background(), &s3.GetObjectInput{
+		Bucket: aws.String(w.bucket),
+		Key:    aws.String(w.key(p)),
+	})
+	if err != nil {
+		var notFound *types.NoSuchKey
+		if errors.As(err, &notFound) {
+			return nil, fmt.Errorf("%w: %s", fs.ErrNotExist, err)
+		}
+		return nil, err
+	}
+	return out.Body, nil
+}
+
+func (w *s3MirrorWriter) StageArtifact(p string) (io.WriteCloser, error) {
+	return &s3StagingWriter{writer: w, key: w.stagingKey(p)}, nil
+}
+
+func (w *s3MirrorWriter) Commit(stagingPath, targetPath string) error {
+	ctx := context.Background()
+	stagingKey := w.stagingKey(stagingPath)
+	targetKey := w.key(targetPath)
+
+	// Confirm the staged upload actually landed before we promote it,
+	// rather than trusting that the earlier PutObject call succeeded.
+	// This only confirms presence, not content integrity: we have no
+	// known-good checksum to compare the staged object's checksum
+	// against here, since the package's own hash was already verified
+	// against its signature back in fetchProviderPackage, before upload.
+	if _, err := w.client.GetObjectAttributes(ctx, &s3.GetObjectAttributesInput{
+		Bucket:           aws.String(w.bucket),
+		Key:              aws.String(stagingKey),
+		ObjectAttributes: []types.ObjectAttributes{types.ObjectAttributesObjectSize},
+	}); err != nil {
+		return fmt.Errorf("staged object %s is missing or unreadable: %w", stagingKey, err)
+	}
+
+	if _, err := w.client.CopyObject(ctx, &s3.CopyObjectInput{
+		Bucket:     aws.String(w.bucket),
+		CopySource: aws.String(path.Join(w.bucket, stagingKey)),
+		Key:        aws.String(targetKey),
+	}); err != nil {
+		return fmt.Errorf("failed to promote %s to %s: %w", stagingKey, targetKey, err)
+	}
+
+	_, err := w.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(w.bucket),
+		Key:    aws.String(stagingKey),
+	})
+	return err
+}
+
+// Abort deletes the staged object, if any. S3's DeleteObject is a no-op
+// rather than an error when the key doesn't exist, so this is also safe to
+// call when StageArtifact's PutObject never happened.
+func (w *s3MirrorWriter) Abort(stagingPath string) error {
+	_, err := w.client.DeleteObject(context.Background(), &s3.DeleteObjectInput{
+		Bucket: aws.String(w.bucket),
+		Key:    aws.String(w.stagingKey(stagingPath)),
+	})
+	return err
+}
+
+func (w *s3MirrorWriter) WriteIndex(p string, data []byte) error {
+	_, err := w.client.PutObject(context.Background(), &s3.PutObjectInput{
+		Bucket:      aws.String(w.bucket),
+		Key:         aws.String(w.key(p)),
+		Body:        bytes.NewReader(data),
+		ContentType: aws.String("application/json"),
+	})
+	return err
+}
+
+// s3StagingWriter buffers a staged artifact in memory and uploads it as a
+// single PutObject when closed, since S3 has no append-then-finalize
+// write API analogous to a local file handle.
+type s3StagingWriter struct {
+	writer *s3MirrorWriter
+	key    string
+	buf    bytes.Buffer
+}
+
+func (s *s3StagingWriter) Write(p []byte) (int, error) {
+	return s.buf.Write(p)
+}
+
+func (s *s3StagingWriter) Close() error {
+	_, err := s.writer.client.PutObject(context.Background(), &s3.PutObjectInput{
+		Bucket: aws.String(s.writer.bucket),
+		Key:    aws.String(s.key),
+		Body:   bytes.NewReader(s.buf.Bytes()),
+	})
+	return err
+}
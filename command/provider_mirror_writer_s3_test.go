@@ -0,0 +1,168 @@
+package command
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// fakeS3API is a minimal in-memory stand-in for s3API, keyed by object key,
+// used to exercise s3MirrorWriter's staging/commit/abort logic without a
+// real bucket.
+type fakeS3API struct {
+	objects          map[string][]byte
+	copyObjectErr    error
+	getAttributesErr error
+	deleteObjectErr  error
+}
+
+func (f *fakeS3API) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	data, ok := f.objects[*params.Key]
+	if !ok {
+		return nil, &types.NoSuchKey{}
+	}
+	return &s3.GetObjectOutput{Body: io.NopCloser(bytes.NewReader(data))}, nil
+}
+
+func (f *fakeS3API) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	data, err := io.ReadAll(params.Body)
+	if err != nil {
+		return nil, err
+	}
+	if f.objects == nil {
+		f.objects = make(map[string][]byte)
+	}
+	f.objects[*params.Key] = data
+	return &s3.PutObjectOutput{}, nil
+}
+
+func (f *fakeS3API) CopyObject(ctx context.Context, params *s3.CopyObjectInput, optFns ...func(*s3.Options)) (*s3.CopyObjectOutput, error) {
+	if f.copyObjectErr != nil {
+		return nil, f.copyObjectErr
+	}
+	// params.CopySource is "bucket/key"; we only need the key suffix this
+	// test package always writes, so a naive split is enough here.
+	srcKey := (*params.CopySource)[len("test-bucket/"):]
+	data, ok := f.objects[srcKey]
+	if !ok {
+		return nil, errors.New("NoSuchKey")
+	}
+	f.objects[*params.Key] = data
+	return &s3.CopyObjectOutput{}, nil
+}
+
+func (f *fakeS3API) DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+	if f.deleteObjectErr != nil {
+		return nil, f.deleteObjectErr
+	}
+	delete(f.objects, *params.Key)
+	return &s3.DeleteObjectOutput{}, nil
+}
+
+func (f *fakeS3API) GetObjectAttributes(ctx context.Context, params *s3.GetObjectAttributesInput, optFns ...func(*s3.Options)) (*s3.GetObjectAttributesOutput, error) {
+	if f.getAttributesErr != nil {
+		return nil, f.getAttributesErr
+	}
+	if _, ok := f.objects[*params.Key]; !ok {
+		return nil, errors.New("NoSuchKey")
+	}
+	return &s3.GetObjectAttributesOutput{}, nil
+}
+
+func TestS3MirrorWriter_OpenNotFound(t *testing.T) {
+	fake := &fakeS3API{objects: make(map[string][]byte)}
+	w := &s3MirrorWriter{client: fake, bucket: "test-bucket", prefix: "mirror"}
+
+	_, err := w.Open("example.com/ns/type/1.0.0.json")
+	if err == nil {
+		t.Fatal("expected an error opening an object that doesn't exist")
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("errors.Is(err, fs.ErrNotExist) = false for %v; want true", err)
+	}
+}
+
+func TestS3MirrorWriter_StageCommit(t *testing.T) {
+	fake := &fakeS3API{objects: make(map[string][]byte)}
+	w := &s3MirrorWriter{client: fake, bucket: "test-bucket", prefix: "mirror"}
+	const stagingPath = ".example.zip"
+
+	staged, err := w.StageArtifact(stagingPath)
+	if err != nil {
+		t.Fatalf("StageArtifact: %s", err)
+	}
+	if _, err := staged.Write([]byte("package contents")); err != nil {
+		t.Fatalf("write: %s", err)
+	}
+	if err := staged.Close(); err != nil {
+		t.Fatalf("close: %s", err)
+	}
+
+	if err := w.Commit(stagingPath, "example.zip"); err != nil {
+		t.Fatalf("Commit: %s", err)
+	}
+
+	if _, ok := fake.objects[w.stagingKey(stagingPath)]; ok {
+		t.Error("staging object was not deleted after a successful commit")
+	}
+	data, ok := fake.objects[w.key("example.zip")]
+	if !ok || string(data) != "package contents" {
+		t.Errorf("target object = %q, %v; want %q, true", data, ok, "package contents")
+	}
+}
+
+func TestS3MirrorWriter_CommitFailsIfStagedObjectMissing(t *testing.T) {
+	fake := &fakeS3API{objects: make(map[string][]byte)}
+	w := &s3MirrorWriter{client: fake, bucket: "test-bucket", prefix: "mirror"}
+
+	err := w.Commit(".example.zip", "example.zip")
+	if err == nil {
+		t.Fatal("expected an error committing a staging object that was never staged")
+	}
+	if _, ok := fake.objects[w.key("example.zip")]; ok {
+		t.Error("target object should not exist after a failed commit")
+	}
+}
+
+func TestS3MirrorWriter_CommitFailsIfCopyFails(t *testing.T) {
+	const stagingPath = ".example.zip"
+	w := &s3MirrorWriter{bucket: "test-bucket", prefix: "mirror"}
+	fake := &fakeS3API{
+		objects:       map[string][]byte{w.stagingKey(stagingPath): []byte("partial")},
+		copyObjectErr: errors.New("AccessDenied"),
+	}
+	w.client = fake
+
+	err := w.Commit(stagingPath, "example.zip")
+	if err == nil {
+		t.Fatal("expected an error when the server-side copy fails")
+	}
+	if _, ok := fake.objects[w.key("example.zip")]; ok {
+		t.Error("target object should not exist after a failed copy")
+	}
+	if _, ok := fake.objects[w.stagingKey(stagingPath)]; !ok {
+		t.Error("staging object should be left in place after a failed copy, not deleted")
+	}
+}
+
+func TestS3MirrorWriter_Abort(t *testing.T) {
+	const stagingPath = ".example.zip"
+	w := &s3MirrorWriter{bucket: "test-bucket", prefix: "mirror"}
+	fake := &fakeS3API{objects: map[string][]byte{
+		w.stagingKey(stagingPath): []byte("partial"),
+	}}
+	w.client = fake
+
+	if err := w.Abort(stagingPath); err != nil {
+		t.Fatalf("Abort: %s", err)
+	}
+	if _, ok := fake.objects[w.stagingKey(stagingPath)]; ok {
+		t.Error("staged object was not removed by Abort")
+	}
+}
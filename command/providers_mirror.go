@@ -1,14 +1,27 @@
 package command
 
 import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
 	"path/filepath"
 
 	"github.com/apparentlymart/go-versions/versions"
+	"github.com/hashicorp/terraform/command/cliconfig"
+	"github.com/hashicorp/terraform/internal/depsfile"
 	"github.com/hashicorp/terraform/internal/getproviders"
 	"github.com/hashicorp/terraform/tfdiags"
 )
 
+// defaultLockFilePath is the dependency lock file that "terraform init"
+// and friends read and write, relative to the current working directory.
+const defaultLockFilePath = ".terraform.lock.hcl"
+
 // ProvidersMirrorCommand is a Command implementation that implements the
 // "terraform providers mirror" command, which populates a directory with
 // local copies of provider plugins needed by the current configuration so
@@ -26,6 +39,9 @@ func (c *ProvidersMirrorCommand) Run(args []string) int {
 	cmdFlags := c.Meta.defaultFlagSet("providers mirror")
 	var optPlatforms FlagStringSlice
 	cmdFlags.Var(&optPlatforms, "platform", "target platform")
+	_, lockFileErr := os.Stat(defaultLockFilePath)
+	optLockFile := cmdFlags.Bool("lock-file", lockFileErr == nil, "mirror exactly the versions recorded in the dependency lock file")
+	optFromOriginOnly := cmdFlags.Bool("from-origin-only", false, "ignore provider_installation configuration and always consult the origin registry")
 	cmdFlags.Usage = func() { c.Ui.Error(c.Help()) }
 	if err := cmdFlags.Parse(args); err != nil {
 		c.Ui.Error(fmt.Sprintf("Error parsing command-line flags: %s\n", err.Error()))
@@ -44,7 +60,17 @@ func (c *ProvidersMirrorCommand) Run(args []string) int {
 		c.showDiagnostics(diags)
 		return 1
 	}
-	outputDir := args[0]
+	target := args[0]
+	writer, err := newMirrorWriter(target)
+	if err != nil {
+		diags = diags.Append(tfdiags.Sourceless(
+			tfdiags.Error,
+			"Invalid target directory",
+			fmt.Sprintf("Can't write a mirror to %s: %s.", target, err),
+		))
+		c.showDiagnostics(diags)
+		return 1
+	}
 
 	var platforms []getproviders.Platform
 	if len(optPlatforms) == 0 {
@@ -70,19 +96,25 @@ func (c *ProvidersMirrorCommand) Run(args []string) int {
 	reqs, moreDiags := config.ProviderRequirements()
 	diags = diags.Append(moreDiags)
 
+	var locks *depsfile.Locks
+	if *optLockFile {
+		var lockDiags tfdiags.Diagnostics
+		locks, lockDiags = depsfile.LoadLocksFromFile(defaultLockFilePath)
+		diags = diags.Append(lockDiags)
+	}
+
 	// If we have any error diagnostics already then we won't proceed further.
 	if diags.HasErrors() {
 		c.showDiagnostics(diags)
 		return 1
 	}
 
-	// Unlike other commands, this command always consults the origin registry
-	// for every provider so that it can be used to update a local mirror
-	// directory without needing to first disable that local mirror
-	// in the CLI configuration.
-	source := getproviders.NewMemoizeSource(
-		getproviders.NewRegistrySource(c.Services),
-	)
+	source, srcDiags := c.providerInstallationSource(*optFromOriginOnly)
+	diags = diags.Append(srcDiags)
+	if diags.HasErrors() {
+		c.showDiagnostics(diags)
+		return 1
+	}
 
 	for provider, constraints := range reqs {
 		if provider.IsBuiltIn() {
@@ -91,28 +123,49 @@ func (c *ProvidersMirrorCommand) Run(args []string) int {
 		}
 		constraintsStr := getproviders.VersionConstraintsString(constraints)
 		c.Ui.Output(fmt.Sprintf("- Mirroring %s...", provider.ForDisplay()))
-		// First we'll look for the latest version that matches the given
-		// constraint, which we'll then try to mirror for each target platform.
-		acceptable := versions.MeetingConstraints(constraints)
-		avail, err := source.AvailableVersions(provider)
-		candidates := avail.Filter(acceptable)
-		if err == nil && len(candidates) == 0 {
-			err = fmt.Errorf("no releases match the given constraints %s", constraintsStr)
-		}
-		if err != nil {
-			diags = diags.Append(tfdiags.Sourceless(
-				tfdiags.Error,
-				"Provider not available",
-				fmt.Sprintf("Failed to download %s from its origin registry: %s.", provider.String(), err),
-			))
-			continue
-		}
-		selected := candidates.Newest()
-		if len(constraintsStr) > 0 {
-			c.Ui.Output(fmt.Sprintf("  - Selected v%s to meet constraints %s", selected.String(), constraintsStr))
+
+		var selected versions.Version
+		var lock *depsfile.ProviderLock
+		if locks != nil {
+			lock = locks.Provider(provider)
+			if lock == nil {
+				diags = diags.Append(tfdiags.Sourceless(
+					tfdiags.Error,
+					"Provider not in dependency lock file",
+					fmt.Sprintf("The dependency lock file does not record a selected version for %s. Run \"terraform init\" to update it, or use -lock-file=false to mirror the newest version matching its constraints instead.", provider.ForDisplay()),
+				))
+				continue
+			}
+			selected = lock.Version()
+			c.Ui.Output(fmt.Sprintf("  - Selected v%s from the dependency lock file", selected.String()))
 		} else {
-			c.Ui.Output(fmt.Sprintf("  - Selected v%s with no constraints", selected.String()))
+			// We'll look for the latest version that matches the given
+			// constraint, which we'll then try to mirror for each target
+			// platform.
+			acceptable := versions.MeetingConstraints(constraints)
+			avail, err := source.AvailableVersions(provider)
+			candidates := avail.Filter(acceptable)
+			if err == nil && len(candidates) == 0 {
+				err = fmt.Errorf("no releases match the given constraints %s", constraintsStr)
+			}
+			if err != nil {
+				diags = diags.Append(tfdiags.Sourceless(
+					tfdiags.Error,
+					"Provider not available",
+					fmt.Sprintf("Failed to find available versions of %s: %s.", provider.String(), err),
+				))
+				continue
+			}
+			selected = candidates.Newest()
+			if len(constraintsStr) > 0 {
+				c.Ui.Output(fmt.Sprintf("  - Selected v%s to meet constraints %s", selected.String(), constraintsStr))
+			} else {
+				c.Ui.Output(fmt.Sprintf("  - Selected v%s with no constraints", selected.String()))
+			}
 		}
+
+		var providerDir string
+		archives := make(map[string]providerMirrorIndexArchive)
 		for _, platform := range platforms {
 			c.Ui.Output(fmt.Sprintf("  - Downloading package for %s...", platform.String()))
 			meta, err := source.PackageMeta(provider, selected, platform)
@@ -124,26 +177,38 @@ func (c *ProvidersMirrorCommand) Run(args []string) int {
 				))
 				continue
 			}
-			url, ok := meta.Location.(getproviders.PackageHTTPURL)
-			if !ok {
-				// We don't expect to get non-HTTP locations here because we're
-				// using the registry source, so this seems like a bug in the
-				// registry source.
-				diags = diags.Append(tfdiags.Sourceless(
-					tfdiags.Error,
-					"Provider release not available",
-					fmt.Sprintf("Failed to download %s v%s for %s: Terraform's provider registry client returned unexpected location type %T. This is a bug in Terraform.", provider.String(), selected.String(), platform.String(), meta.Location),
-				))
+			// targetPath is the path, relative to the mirror root, where we
+			// ultimately want to place the mirrored archive, but we'll
+			// place it initially at stagingPath so we can verify its
+			// checksums and signatures before making it discoverable to
+			// mirror clients. (stagingPath intentionally does not follow
+			// the filesystem mirror file naming convention.)
+			targetPath := meta.PackedFilePath("")
+			stagingPath := filepath.Join(filepath.Dir(targetPath), "."+filepath.Base(targetPath))
+			providerDir = filepath.Dir(targetPath)
+
+			hash, fetchDiags := c.fetchProviderPackage(writer, meta, targetPath, stagingPath)
+			diags = diags.Append(fetchDiags)
+			if fetchDiags.HasErrors() {
 				continue
 			}
-			// targetPath is the path where we ultimately want to place the
-			// downloaded archive, but we'll place it initially at stagingPath
-			// so we can verify its checksums and signatures before making
-			// it discoverable to mirror clients. (stagingPath intentionally
-			// does not follow the filesystem mirror file naming convention.)
-			targetPath := meta.PackedFilePath(outputDir)
-			stagingPath := filepath.Join(filepath.Dir(targetPath), "."+filepath.Base(targetPath))
-			fmt.Printf("TODO: Download %s to %s via %s\n", url, targetPath, stagingPath)
+
+			hashes := []string{hash}
+			if lock != nil {
+				recorded, extended := c.reconcileLockHashes(lock, hash)
+				if extended {
+					c.Ui.Output(fmt.Sprintf("  - Warning: the dependency lock file has no recorded hash for %s; extending the mirror's hash set with %s", platform.String(), hash))
+				}
+				hashes = recorded
+			}
+			archives[platform.String()] = providerMirrorIndexArchive{
+				URL:    filepath.Base(targetPath),
+				Hashes: hashes,
+			}
+		}
+
+		if providerDir != "" && len(archives) > 0 {
+			diags = diags.Append(c.updateProviderMirrorIndex(writer, providerDir, selected.String(), archives))
 		}
 	}
 
@@ -154,6 +219,491 @@ func (c *ProvidersMirrorCommand) Run(args []string) int {
 	return 0
 }
 
+// fetchProviderPackage obtains the package described by meta, verifies it
+// against meta.Authentication, and on success stages it in writer and
+// commits it into place at targetPath. It returns the package's SHA256
+// hash, in the "zh:" legacy zip-hash scheme used by the network mirror
+// protocol, for use in the generated index files.
+//
+// If targetPath already exists in writer and passes the same verification
+// a fresh download would get (see verifyExistingArtifact), then the fetch
+// is skipped and the existing archive's hash is returned instead, so that
+// re-running the command is cheap and incremental. An existing archive
+// that fails verification is fetched again and replaced.
+//
+// meta.Location determines how the package is obtained: a
+// getproviders.PackageHTTPURL is downloaded, while a
+// getproviders.PackageLocalArchive (as produced by a filesystem-mirror
+// source) is read directly from disk. Either way the package is first
+// written to a local temporary file, because meta.Authentication needs a
+// real archive on disk to check its signature, before being handed to
+// writer for staging and commit; this keeps that verification step the
+// same regardless of which kind of storage writer ultimately holds it.
+func (c *ProvidersMirrorCommand) fetchProviderPackage(writer MirrorWriter, meta getproviders.PackageMeta, targetPath, stagingPath string) (string, tfdiags.Diagnostics) {
+	var diags tfdiags.Diagnostics
+
+	if hash, ok := c.verifyExistingArtifact(writer, meta, targetPath); ok {
+		c.Ui.Output(fmt.Sprintf("  - Skipping %s because a correct copy is already present", targetPath))
+		return hash, diags
+	}
+
+	src, srcDesc, err := openProviderPackageSource(meta.Location)
+	if err != nil {
+		diags = diags.Append(tfdiags.Sourceless(
+			tfdiags.Error,
+			"Failed to fetch provider package",
+			fmt.Sprintf("Error reading %s: %s.", srcDesc, err),
+		))
+		return "", diags
+	}
+	defer src.Close()
+
+	tmp, err := os.CreateTemp("", "terraform-provider-mirror-*.zip")
+	if err != nil {
+		diags = diags.Append(tfdiags.Sourceless(
+			tfdiags.Error,
+			"Failed to fetch provider package",
+			fmt.Sprintf("Could not create a temporary file to stage the download: %s.", err),
+		))
+		return "", diags
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+
+	_, err = io.Copy(tmp, src)
+	closeErr := tmp.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		diags = diags.Append(tfdiags.Sourceless(
+			tfdiags.Error,
+			"Failed to fetch provider package",
+			fmt.Sprintf("Error writing %s: %s.", srcDesc, err),
+		))
+		return "", diags
+	}
+
+	if meta.Authentication != nil {
+		if _, err := meta.Authentication.AuthenticatePackage(getproviders.PackageLocalArchive(tmpPath)); err != nil {
+			diags = diags.Append(tfdiags.Sourceless(
+				tfdiags.Error,
+				"Failed to verify provider package",
+				fmt.Sprintf("The package obtained from %s did not pass authentication: %s.", srcDesc, err),
+			))
+			return "", diags
+		}
+	}
+
+	hash, err := hashProviderPackageFile(tmpPath)
+	if err != nil {
+		diags = diags.Append(tfdiags.Sourceless(
+			tfdiags.Error,
+			"Failed to verify provider package",
+			fmt.Sprintf("Could not hash %s: %s.", tmpPath, err),
+		))
+		return "", diags
+	}
+
+	if err := c.stageAndCommit(writer, tmpPath, stagingPath, targetPath); err != nil {
+		diags = diags.Append(tfdiags.Sourceless(
+			tfdiags.Error,
+			"Failed to install provider package",
+			fmt.Sprintf("Could not write %s to the mirror: %s.", targetPath, err),
+		))
+		return "", diags
+	}
+
+	return hash, diags
+}
+
+// verifyExistingArtifact checks whether a copy of meta already committed at
+// targetPath in writer is still good, so that fetchProviderPackage can skip
+// re-fetching it. It is not enough for the existing file to merely be
+// present and readable: a previous run could have been interrupted midway
+// through a copy, or the provider could have been republished at the same
+// version with different content, so we re-run the same authentication
+// check a fresh download would get before trusting it.
+//
+// It returns the hash of the existing artifact and true if it is good to
+// keep, or ("", false) if it is missing, unreadable, or fails verification,
+// in which case the caller should fall through to a normal fetch.
+func (c *ProvidersMirrorCommand) verifyExistingArtifact(writer MirrorWriter, meta getproviders.PackageMeta, targetPath string) (string, bool) {
+	existing, err := writer.Open(targetPath)
+	if err != nil {
+		return "", false
+	}
+	defer existing.Close()
+
+	tmp, err := os.CreateTemp("", "terraform-provider-mirror-verify-*.zip")
+	if err != nil {
+		return "", false
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+
+	_, err = io.Copy(tmp, existing)
+	closeErr := tmp.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", false
+	}
+
+	if meta.Authentication != nil {
+		if _, err := meta.Authentication.AuthenticatePackage(getproviders.PackageLocalArchive(tmpPath)); err != nil {
+			return "", false
+		}
+	}
+
+	hash, err := hashProviderPackageFile(tmpPath)
+	if err != nil {
+		return "", false
+	}
+	return hash, true
+}
+
+// stageAndCommit copies the verified local file at tmpPath into writer at
+// stagingPath and then commits it into place at targetPath.
+//
+// If anything goes wrong after the staged artifact has started being
+// written, it calls writer.Abort to remove it rather than leaving it
+// behind: for a local writer that's just a stray "."-prefixed file, but
+// for an object storage writer Close has already finalized an upload, so
+// without this the ".staging/" object would be left there forever.
+func (c *ProvidersMirrorCommand) stageAndCommit(writer MirrorWriter, tmpPath, stagingPath, targetPath string) (err error) {
+	tmp, err := os.Open(tmpPath)
+	if err != nil {
+		return err
+	}
+	defer tmp.Close()
+
+	staged, err := writer.StageArtifact(stagingPath)
+	if err != nil {
+		return err
+	}
+
+	succeeded := false
+	defer func() {
+		if !succeeded {
+			if abortErr := writer.Abort(stagingPath); abortErr != nil {
+				err = fmt.Errorf("%w (additionally, failed to clean up the staged copy: %s)", err, abortErr)
+			}
+		}
+	}()
+
+	_, err = io.Copy(staged, tmp)
+	closeErr := staged.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	if err = writer.Commit(stagingPath, targetPath); err != nil {
+		return err
+	}
+
+	succeeded = true
+	return nil
+}
+
+// openProviderPackageSource opens loc for reading, along with a short
+// human-readable description of it for use in error messages. The caller
+// is responsible for closing the returned reader.
+func openProviderPackageSource(loc getproviders.PackageLocation) (io.ReadCloser, string, error) {
+	switch loc := loc.(type) {
+	case getproviders.PackageHTTPURL:
+		resp, err := http.Get(string(loc))
+		if err != nil {
+			return nil, string(loc), err
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, string(loc), fmt.Errorf("server responded with %s", resp.Status)
+		}
+		return resp.Body, string(loc), nil
+	case getproviders.PackageLocalArchive:
+		// This is the shape returned by a filesystem-mirror source: the
+		// package already exists on disk as a zip archive, so we just
+		// copy it into the mirror rather than downloading it again.
+		f, err := os.Open(string(loc))
+		return f, string(loc), err
+	default:
+		return nil, fmt.Sprintf("%v", loc), fmt.Errorf("unsupported provider package location type %T", loc)
+	}
+}
+
+// providerInstallationSource builds the getproviders.Source that Run uses
+// to discover and fetch provider packages.
+//
+// By default it honors the same provider_installation block in the CLI
+// configuration that "terraform init" uses, so that operators can
+// re-mirror from an existing network or filesystem mirror rather than
+// always hitting the origin registry. Passing fromOriginOnly restores the
+// previous hard-coded behavior of always consulting the origin registry,
+// ignoring any provider_installation configuration.
+func (c *ProvidersMirrorCommand) providerInstallationSource(fromOriginOnly bool) (getproviders.Source, tfdiags.Diagnostics) {
+	var diags tfdiags.Diagnostics
+
+	if fromOriginOnly {
+		return getproviders.NewMemoizeSource(
+			getproviders.NewRegistrySource(c.Services),
+		), diags
+	}
+
+	cfg, cfgDiags := cliconfig.LoadConfig()
+	diags = diags.Append(cfgDiags)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	if len(cfg.ProviderInstallation) == 0 || len(cfg.ProviderInstallation[0].Methods) == 0 {
+		return getproviders.NewMemoizeSource(
+			getproviders.NewRegistrySource(c.Services),
+		), diags
+	}
+
+	return c.providerInstallationMultiSource(cfg.ProviderInstallation[0].Methods)
+}
+
+// providerInstallationMultiSource builds the getproviders.Source for a
+// non-empty set of provider_installation methods, dispatching each one to
+// the kind of getproviders.Source it corresponds to and combining them into
+// a single prioritized getproviders.MultiSource. It's split out from
+// providerInstallationSource so that this dispatch and error-handling logic
+// can be tested without needing a real CLI config file on disk.
+func (c *ProvidersMirrorCommand) providerInstallationMultiSource(methods []cliconfig.ProviderInstallationMethod) (getproviders.Source, tfdiags.Diagnostics) {
+	var diags tfdiags.Diagnostics
+
+	var multiSource getproviders.MultiSource
+	for _, method := range methods {
+		var methodSource getproviders.Source
+		switch location := method.Location.(type) {
+		case cliconfig.ProviderInstallationFilesystemMirror:
+			methodSource = getproviders.NewFilesystemMirrorSource(string(location))
+		case cliconfig.ProviderInstallationNetworkMirror:
+			source, err := getproviders.NewHTTPMirrorSource(string(location), c.Services.CredentialsSource())
+			if err != nil {
+				diags = diags.Append(tfdiags.Sourceless(
+					tfdiags.Error,
+					"Invalid network_mirror provider installation method",
+					fmt.Sprintf("The network mirror at %s is not valid: %s.", location, err),
+				))
+				continue
+			}
+			methodSource = source
+		case cliconfig.ProviderInstallationDirect:
+			methodSource = getproviders.NewRegistrySource(c.Services)
+		default:
+			diags = diags.Append(tfdiags.Sourceless(
+				tfdiags.Error,
+				"Unsupported provider installation method",
+				fmt.Sprintf("The provider_installation configuration contains a %T method, which \"terraform providers mirror\" does not know how to re-mirror from. Use -from-origin-only to bypass provider_installation entirely.", method.Location),
+			))
+			continue
+		}
+
+		include, err := getproviders.ParseMultiSourceMatchingPatterns(method.Include)
+		if err != nil {
+			diags = diags.Append(tfdiags.Sourceless(
+				tfdiags.Error,
+				"Invalid provider_installation include pattern",
+				err.Error(),
+			))
+			continue
+		}
+		exclude, err := getproviders.ParseMultiSourceMatchingPatterns(method.Exclude)
+		if err != nil {
+			diags = diags.Append(tfdiags.Sourceless(
+				tfdiags.Error,
+				"Invalid provider_installation exclude pattern",
+				err.Error(),
+			))
+			continue
+		}
+		multiSource = append(multiSource, getproviders.MultiSourceSelector{
+			Source:  methodSource,
+			Include: include,
+			Exclude: exclude,
+		})
+	}
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	return getproviders.NewMemoizeSource(multiSource), diags
+}
+
+// reconcileLockHashes combines the hashes already recorded for a provider in
+// the dependency lock file with the zh: hash we just computed for one of its
+// archives, so that an offline install can satisfy the lock from the mirror
+// alone. The lock file's hash set isn't scoped to a single platform -- it
+// accumulates zh: hashes across every platform "terraform providers lock"
+// has been run for -- so the mere presence of some zh: hash doesn't tell us
+// anything about computedHash specifically: a lock with a zh: hash for
+// linux_amd64 says nothing about whether darwin_arm64's hash is recorded.
+// computedHash is only appended when it isn't already a member of the
+// lock's hash set; appending it unconditionally whenever the lock has any
+// zh: hash at all would both fail to extend the set for this platform and,
+// on a subsequent run where it already is present, add a duplicate. It
+// returns true in its second result if computedHash was not already
+// present, meaning we're extending the mirror's hash set rather than
+// merely corroborating it.
+func (c *ProvidersMirrorCommand) reconcileLockHashes(lock *depsfile.ProviderLock, computedHash string) ([]string, bool) {
+	haveComputed := false
+	hashes := make([]string, 0, len(lock.AllHashes())+1)
+	for _, h := range lock.AllHashes() {
+		s := string(h)
+		hashes = append(hashes, s)
+		if s == computedHash {
+			haveComputed = true
+		}
+	}
+	if !haveComputed {
+		hashes = append(hashes, computedHash)
+	}
+	return hashes, !haveComputed
+}
+
+// hashProviderPackageFile returns the "zh:" legacy zip-hash of the file at
+// filename, which must exist and be readable.
+func hashProviderPackageFile(filename string) (string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return hashProviderPackageReader(f)
+}
+
+// hashProviderPackageReader returns the "zh:" legacy zip-hash of the
+// content read from r.
+func hashProviderPackageReader(r io.Reader) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("zh:%x", h.Sum(nil)), nil
+}
+
+// providerMirrorIndex is the JSON structure written to
+// <hostname>/<namespace>/<type>/index.json, listing the versions of a
+// provider that are present in the mirror. It matches the network-mirror
+// protocol consumed by getproviders.NewHTTPMirrorSource.
+type providerMirrorIndex struct {
+	Versions map[string]providerMirrorIndexVersion `json:"versions"`
+}
+
+// providerMirrorIndexVersion is currently always an empty object; the
+// network-mirror protocol reserves it for future per-version metadata.
+type providerMirrorIndexVersion struct{}
+
+// providerMirrorVersionIndex is the JSON structure written to
+// <hostname>/<namespace>/<type>/<version>.json, listing the package for
+// each platform that's available for one version of a provider.
+type providerMirrorVersionIndex struct {
+	Archives map[string]providerMirrorIndexArchive `json:"archives"`
+}
+
+// providerMirrorIndexArchive describes a single platform's package within
+// a providerMirrorVersionIndex.
+type providerMirrorIndexArchive struct {
+	URL    string   `json:"url"`
+	Hashes []string `json:"hashes,omitempty"`
+}
+
+// updateProviderMirrorIndex merges archives into the per-version index file
+// for the given version, preserving any other platforms already recorded
+// there, and merges the version into the provider's top-level index file,
+// preserving any other versions already recorded there, so that mirroring
+// is incremental: re-running the command with a different -platform set
+// for a version that's already mirrored adds to it rather than replacing
+// it.
+func (c *ProvidersMirrorCommand) updateProviderMirrorIndex(writer MirrorWriter, providerDir, version string, archives map[string]providerMirrorIndexArchive) tfdiags.Diagnostics {
+	var diags tfdiags.Diagnostics
+
+	versionIndexPath := filepath.Join(providerDir, version+".json")
+	var versionIndex providerMirrorVersionIndex
+	if existing, err := writer.Open(versionIndexPath); err == nil {
+		// We ignore errors from a malformed existing index and just
+		// replace it, since that can only happen if it was manually edited
+		// or left over from an incompatible tool version.
+		data, readErr := io.ReadAll(existing)
+		existing.Close()
+		if readErr == nil {
+			json.Unmarshal(data, &versionIndex)
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		diags = diags.Append(tfdiags.Sourceless(
+			tfdiags.Error,
+			"Failed to read mirror index",
+			fmt.Sprintf("Could not read the existing %s to merge it with the newly-mirrored platforms: %s.", versionIndexPath, err),
+		))
+		return diags
+	}
+	if versionIndex.Archives == nil {
+		versionIndex.Archives = make(map[string]providerMirrorIndexArchive)
+	}
+	for platform, archive := range archives {
+		versionIndex.Archives[platform] = archive
+	}
+	if err := writeProviderMirrorJSON(writer, versionIndexPath, &versionIndex); err != nil {
+		diags = diags.Append(tfdiags.Sourceless(
+			tfdiags.Error,
+			"Failed to write mirror index",
+			fmt.Sprintf("Could not write %s: %s.", versionIndexPath, err),
+		))
+		return diags
+	}
+
+	topIndexPath := filepath.Join(providerDir, "index.json")
+	var topIndex providerMirrorIndex
+	if existing, err := writer.Open(topIndexPath); err == nil {
+		// We ignore errors from a malformed existing index and just
+		// replace it, since that can only happen if it was manually edited
+		// or left over from an incompatible tool version.
+		data, readErr := io.ReadAll(existing)
+		existing.Close()
+		if readErr == nil {
+			json.Unmarshal(data, &topIndex)
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		diags = diags.Append(tfdiags.Sourceless(
+			tfdiags.Error,
+			"Failed to read mirror index",
+			fmt.Sprintf("Could not read the existing %s to merge it with the newly-mirrored version: %s.", topIndexPath, err),
+		))
+		return diags
+	}
+	if topIndex.Versions == nil {
+		topIndex.Versions = make(map[string]providerMirrorIndexVersion)
+	}
+	topIndex.Versions[version] = providerMirrorIndexVersion{}
+	if err := writeProviderMirrorJSON(writer, topIndexPath, &topIndex); err != nil {
+		diags = diags.Append(tfdiags.Sourceless(
+			tfdiags.Error,
+			"Failed to write mirror index",
+			fmt.Sprintf("Could not write %s: %s.", topIndexPath, err),
+		))
+	}
+
+	return diags
+}
+
+// writeProviderMirrorJSON marshals v as indented JSON and writes it to
+// path via writer, replacing any existing content there.
+func writeProviderMirrorJSON(writer MirrorWriter, path string, v interface{}) error {
+	src, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	src = append(src, '\n')
+	return writer.WriteIndex(path, src)
+}
+
 func (c *ProvidersMirrorCommand) Help() string {
 	return `
 Usage: terraform providers mirror [options] <target-dir>
@@ -168,6 +718,11 @@ Usage: terraform providers mirror [options] <target-dir>
   a network mirror. Those index files will be ignored if the directory is
   used instead as a local filesystem mirror.
 
+  <target-dir> is usually a local path, but it may instead be an
+  "s3://bucket/prefix", "gs://bucket/prefix", or "azblob://container/prefix"
+  URL to write the mirror directly to object storage, for teams that serve
+  their network mirror from there instead of a workstation filesystem.
+
 Options:
 
   -platform=os_arch  Choose which target platform to build a mirror for.
@@ -181,5 +736,20 @@ Options:
                      Linux operating system running on an AMD64 or x86_64
                      CPU. Each provider is available only for a limited
                      set of target platforms.
+
+  -lock-file=true    Mirror exactly the provider versions recorded in
+                     .terraform.lock.hcl, rather than the newest version
+                     matching each provider's version constraints. This is
+                     on by default when that file is present, so that the
+                     mirror matches what "terraform init" actually
+                     selected. Set to false to restore the latest-matching
+                     behavior.
+
+  -from-origin-only Always fetch providers from their origin registry,
+                     ignoring any provider_installation configuration in
+                     the CLI configuration. Use this to restore providers
+                     into a mirror from scratch even when the CLI
+                     configuration has been set up to prefer an existing
+                     mirror.
 `
 }
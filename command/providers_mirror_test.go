@@ -0,0 +1,451 @@
+package command
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/apparentlymart/go-versions/versions"
+	"github.com/hashicorp/terraform/addrs"
+	"github.com/hashicorp/terraform/command/cliconfig"
+	"github.com/hashicorp/terraform/internal/depsfile"
+	"github.com/hashicorp/terraform/internal/getproviders"
+)
+
+// fakeContentAuthentication is a getproviders.PackageAuthentication that
+// accepts a package only if its bytes exactly match want, so tests can
+// distinguish a good archive from a corrupted or stale one without needing
+// real signing keys.
+type fakeContentAuthentication struct {
+	want []byte
+}
+
+func (a fakeContentAuthentication) AuthenticatePackage(localLocation getproviders.PackageLocation) (*getproviders.PackageAuthenticationResult, error) {
+	archive, ok := localLocation.(getproviders.PackageLocalArchive)
+	if !ok {
+		return nil, fmt.Errorf("expected a local archive to authenticate, got %T", localLocation)
+	}
+	got, err := os.ReadFile(string(archive))
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(got, a.want) {
+		return nil, fmt.Errorf("package content does not match the expected authenticated content")
+	}
+	return nil, nil
+}
+
+func TestFetchProviderPackage_SkipsAndRefetches(t *testing.T) {
+	content := []byte("pretend provider zip contents")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(content)
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	writer := newLocalMirrorWriter(dir)
+	c := &ProvidersMirrorCommand{}
+
+	meta := getproviders.PackageMeta{
+		Location:       getproviders.PackageHTTPURL(srv.URL),
+		Authentication: fakeContentAuthentication{want: content},
+	}
+
+	const targetPath = "example.com/ns/type/terraform-provider-type_1.0.0_linux_amd64.zip"
+	stagingPath := filepath.Join(filepath.Dir(targetPath), "."+filepath.Base(targetPath))
+	full := filepath.Join(dir, targetPath)
+
+	hash1, diags := c.fetchProviderPackage(writer, meta, targetPath, stagingPath)
+	if diags.HasErrors() {
+		t.Fatalf("unexpected errors on first fetch: %s", diags.Err())
+	}
+
+	t.Run("skips a correct existing archive", func(t *testing.T) {
+		requests := 0
+		srv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			w.Write(content)
+		})
+		hash2, diags := c.fetchProviderPackage(writer, meta, targetPath, stagingPath)
+		if diags.HasErrors() {
+			t.Fatalf("unexpected errors: %s", diags.Err())
+		}
+		if requests != 0 {
+			t.Errorf("source was fetched %d times; want 0, since the existing archive is already correct", requests)
+		}
+		if hash2 != hash1 {
+			t.Errorf("got hash %s for an unchanged skip; want the original hash %s", hash2, hash1)
+		}
+	})
+
+	t.Run("re-fetches a corrupted existing archive", func(t *testing.T) {
+		if err := os.WriteFile(full, []byte("truncated or corrupted content"), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		hash3, diags := c.fetchProviderPackage(writer, meta, targetPath, stagingPath)
+		if diags.HasErrors() {
+			t.Fatalf("unexpected errors: %s", diags.Err())
+		}
+		if hash3 != hash1 {
+			t.Errorf("got hash %s after recovering from corruption; want the original hash %s", hash3, hash1)
+		}
+
+		got, err := os.ReadFile(full)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, content) {
+			t.Errorf("mirrored archive content = %q after re-fetch; want %q", got, content)
+		}
+	})
+}
+
+func TestReconcileLockHashes(t *testing.T) {
+	c := &ProvidersMirrorCommand{}
+	version := versions.Must(versions.ParseVersion("1.0.0"))
+	provider := addrs.NewDefaultProvider("test")
+
+	t.Run("does not duplicate an existing zh hash", func(t *testing.T) {
+		lock := depsfile.NewProviderLock(provider, version, versions.Set{}, []getproviders.Hash{
+			"h1:existing",
+			"zh:existing",
+		})
+
+		hashes, extended := c.reconcileLockHashes(lock, "zh:existing")
+		if extended {
+			t.Errorf("extended = true; want false, since the lock already records zh:existing")
+		}
+		count := 0
+		for _, h := range hashes {
+			if h == "zh:existing" {
+				count++
+			}
+		}
+		if count != 1 {
+			t.Errorf("got %d copies of zh:existing in %v; want exactly 1", count, hashes)
+		}
+	})
+
+	t.Run("extends a lock with no zh hash", func(t *testing.T) {
+		lock := depsfile.NewProviderLock(provider, version, versions.Set{}, []getproviders.Hash{
+			"h1:existing",
+		})
+
+		hashes, extended := c.reconcileLockHashes(lock, "zh:computed")
+		if !extended {
+			t.Errorf("extended = false; want true, since the lock had no zh: hash yet")
+		}
+		found := false
+		for _, h := range hashes {
+			if h == "zh:computed" {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("zh:computed not present in %v", hashes)
+		}
+	})
+
+	t.Run("extends a lock that has a different platform's zh hash", func(t *testing.T) {
+		// A lock can carry a zh: hash for, say, linux_amd64 while having
+		// none recorded yet for darwin_arm64. The mere presence of some
+		// zh: hash must not be mistaken for this platform's hash already
+		// being present.
+		lock := depsfile.NewProviderLock(provider, version, versions.Set{}, []getproviders.Hash{
+			"zh:linuxhash",
+		})
+
+		hashes, extended := c.reconcileLockHashes(lock, "zh:darwinhash")
+		if !extended {
+			t.Errorf("extended = false; want true, since zh:darwinhash was not already recorded")
+		}
+		found := false
+		for _, h := range hashes {
+			if h == "zh:darwinhash" {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("zh:darwinhash not present in %v; an unrelated platform's zh: hash must not suppress this one", hashes)
+		}
+		if _, ok := find(hashes, "zh:linuxhash"); !ok {
+			t.Errorf("zh:linuxhash dropped from %v; reconcileLockHashes must not discard other platforms' hashes", hashes)
+		}
+	})
+}
+
+func find(haystack []string, needle string) (int, bool) {
+	for i, s := range haystack {
+		if s == needle {
+			return i, true
+		}
+	}
+	return -1, false
+}
+
+// In TestProviderInstallationMultiSource, the "unsupported method type"
+// case uses a nil Location to exercise the default branch of
+// providerInstallationMultiSource
+// without needing to implement cliconfig's unexported
+// ProviderInstallationMethodLocation interface: nil is assignable to any
+// interface type and matches no case in the type switch, so it falls
+// through to default exactly as a method type this command doesn't know
+// about would.
+func TestProviderInstallationMultiSource(t *testing.T) {
+	c := &ProvidersMirrorCommand{}
+
+	tests := []struct {
+		name       string
+		methods    []cliconfig.ProviderInstallationMethod
+		wantErr    bool
+		wantErrMsg string
+	}{
+		{
+			name: "filesystem_mirror and direct methods combine without error",
+			methods: []cliconfig.ProviderInstallationMethod{
+				{Location: cliconfig.ProviderInstallationFilesystemMirror("/tmp/mirror")},
+				{Location: cliconfig.ProviderInstallationDirect{}},
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid include pattern",
+			methods: []cliconfig.ProviderInstallationMethod{
+				{
+					Location: cliconfig.ProviderInstallationFilesystemMirror("/tmp/mirror"),
+					Include:  []string{"not-a-valid-pattern"},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid exclude pattern",
+			methods: []cliconfig.ProviderInstallationMethod{
+				{
+					Location: cliconfig.ProviderInstallationFilesystemMirror("/tmp/mirror"),
+					Exclude:  []string{"not-a-valid-pattern"},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "unsupported method type",
+			methods: []cliconfig.ProviderInstallationMethod{
+				{Location: nil},
+			},
+			wantErr: true,
+		},
+		{
+			name:    "empty method list produces an empty, error-free source",
+			methods: nil,
+			wantErr: false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			source, diags := c.providerInstallationMultiSource(test.methods)
+			if diags.HasErrors() != test.wantErr {
+				t.Fatalf("diags.HasErrors() = %v; want %v (diags: %s)", diags.HasErrors(), test.wantErr, diags.Err())
+			}
+			if test.wantErr {
+				if source != nil {
+					t.Errorf("got non-nil source %v on error; want nil", source)
+				}
+				return
+			}
+			if source == nil {
+				t.Errorf("got nil source with no errors")
+			}
+		})
+	}
+}
+
+func TestUpdateProviderMirrorIndex_MergesExistingVersions(t *testing.T) {
+	dir := t.TempDir()
+	writer := newLocalMirrorWriter(dir)
+	c := &ProvidersMirrorCommand{}
+	const providerDir = "example.com/ns/type"
+
+	diags := c.updateProviderMirrorIndex(writer, providerDir, "1.0.0", map[string]providerMirrorIndexArchive{
+		"linux_amd64": {URL: "terraform-provider-type_1.0.0_linux_amd64.zip", Hashes: []string{"zh:one"}},
+	})
+	if diags.HasErrors() {
+		t.Fatalf("unexpected errors: %s", diags.Err())
+	}
+
+	diags = c.updateProviderMirrorIndex(writer, providerDir, "2.0.0", map[string]providerMirrorIndexArchive{
+		"linux_amd64": {URL: "terraform-provider-type_2.0.0_linux_amd64.zip", Hashes: []string{"zh:two"}},
+	})
+	if diags.HasErrors() {
+		t.Fatalf("unexpected errors: %s", diags.Err())
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, providerDir, "index.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var topIndex providerMirrorIndex
+	if err := json.Unmarshal(data, &topIndex); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := topIndex.Versions["1.0.0"]; !ok {
+		t.Errorf("index.json lost the 1.0.0 entry after mirroring 2.0.0: %v", topIndex.Versions)
+	}
+	if _, ok := topIndex.Versions["2.0.0"]; !ok {
+		t.Errorf("index.json is missing the 2.0.0 entry: %v", topIndex.Versions)
+	}
+
+	versionData, err := os.ReadFile(filepath.Join(dir, providerDir, "1.0.0.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var versionIndex providerMirrorVersionIndex
+	if err := json.Unmarshal(versionData, &versionIndex); err != nil {
+		t.Fatal(err)
+	}
+	if archive, ok := versionIndex.Archives["linux_amd64"]; !ok || archive.URL != "terraform-provider-type_1.0.0_linux_amd64.zip" {
+		t.Errorf("1.0.0.json archives = %v; want the linux_amd64 entry preserved untouched", versionIndex.Archives)
+	}
+}
+
+func TestUpdateProviderMirrorIndex_MergesPlatformsWithinAVersion(t *testing.T) {
+	dir := t.TempDir()
+	writer := newLocalMirrorWriter(dir)
+	c := &ProvidersMirrorCommand{}
+	const providerDir = "example.com/ns/type"
+
+	diags := c.updateProviderMirrorIndex(writer, providerDir, "1.0.0", map[string]providerMirrorIndexArchive{
+		"linux_amd64": {URL: "terraform-provider-type_1.0.0_linux_amd64.zip", Hashes: []string{"zh:one"}},
+	})
+	if diags.HasErrors() {
+		t.Fatalf("unexpected errors: %s", diags.Err())
+	}
+
+	// Re-running for the same version with a different -platform set, as
+	// happens when mirroring incrementally, must add to the version's
+	// archives rather than replacing them.
+	diags = c.updateProviderMirrorIndex(writer, providerDir, "1.0.0", map[string]providerMirrorIndexArchive{
+		"darwin_arm64": {URL: "terraform-provider-type_1.0.0_darwin_arm64.zip", Hashes: []string{"zh:two"}},
+	})
+	if diags.HasErrors() {
+		t.Fatalf("unexpected errors: %s", diags.Err())
+	}
+
+	versionData, err := os.ReadFile(filepath.Join(dir, providerDir, "1.0.0.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var versionIndex providerMirrorVersionIndex
+	if err := json.Unmarshal(versionData, &versionIndex); err != nil {
+		t.Fatal(err)
+	}
+	if archive, ok := versionIndex.Archives["linux_amd64"]; !ok || archive.URL != "terraform-provider-type_1.0.0_linux_amd64.zip" {
+		t.Errorf("1.0.0.json lost the linux_amd64 entry after mirroring darwin_arm64: %v", versionIndex.Archives)
+	}
+	if archive, ok := versionIndex.Archives["darwin_arm64"]; !ok || archive.URL != "terraform-provider-type_1.0.0_darwin_arm64.zip" {
+		t.Errorf("1.0.0.json is missing the darwin_arm64 entry: %v", versionIndex.Archives)
+	}
+}
+
+// fakeFailingOpenMirrorWriter wraps a localMirrorWriter but makes Open fail
+// with an error that does not satisfy os.IsNotExist, simulating a
+// transient read failure on an object storage backend, to verify that
+// updateProviderMirrorIndex doesn't mistake that for "no prior versions".
+type fakeFailingOpenMirrorWriter struct {
+	*localMirrorWriter
+}
+
+func (w *fakeFailingOpenMirrorWriter) Open(path string) (io.ReadCloser, error) {
+	return nil, fmt.Errorf("simulated transient read failure")
+}
+
+func TestUpdateProviderMirrorIndex_SurfacesTransientReadErrors(t *testing.T) {
+	dir := t.TempDir()
+	writer := &fakeFailingOpenMirrorWriter{localMirrorWriter: newLocalMirrorWriter(dir)}
+	c := &ProvidersMirrorCommand{}
+	const providerDir = "example.com/ns/type"
+
+	diags := c.updateProviderMirrorIndex(writer, providerDir, "1.0.0", map[string]providerMirrorIndexArchive{
+		"linux_amd64": {URL: "terraform-provider-type_1.0.0_linux_amd64.zip", Hashes: []string{"zh:one"}},
+	})
+	if !diags.HasErrors() {
+		t.Fatal("expected an error diagnostic from a transient read failure, got none")
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, providerDir, "index.json")); err == nil {
+		t.Error("index.json should not have been written after a transient read failure merging it")
+	}
+}
+
+// TestUpdateProviderMirrorIndex_FirstMirrorToObjectStorage drives
+// updateProviderMirrorIndex through each object-storage MirrorWriter on a
+// provider that has never been mirrored before, so both Open calls inside
+// it hit a "not found yet" response from the real backend. Each writer's
+// Open must report that with an error satisfying
+// errors.Is(err, fs.ErrNotExist), or updateProviderMirrorIndex mistakes it
+// for a genuine read failure and refuses to write index.json or
+// <version>.json at all -- which would mean "terraform providers mirror"
+// can never produce an index against that kind of target.
+func TestUpdateProviderMirrorIndex_FirstMirrorToObjectStorage(t *testing.T) {
+	c := &ProvidersMirrorCommand{}
+	const providerDir = "example.com/ns/type"
+	archives := map[string]providerMirrorIndexArchive{
+		"linux_amd64": {URL: "terraform-provider-type_1.0.0_linux_amd64.zip", Hashes: []string{"zh:one"}},
+	}
+
+	writers := map[string]MirrorWriter{
+		"s3":    &s3MirrorWriter{client: &fakeS3API{objects: make(map[string][]byte)}, bucket: "test-bucket"},
+		"gcs":   &gcsMirrorWriter{store: &fakeGCSObjectStore{objects: make(map[string][]byte)}},
+		"azure": &azureBlobMirrorWriter{store: &fakeAzureBlobStore{blobs: make(map[string][]byte)}},
+	}
+
+	for name, writer := range writers {
+		t.Run(name, func(t *testing.T) {
+			diags := c.updateProviderMirrorIndex(writer, providerDir, "1.0.0", archives)
+			if diags.HasErrors() {
+				t.Fatalf("unexpected errors mirroring a new provider for the first time: %s", diags.Err())
+			}
+
+			versionData, err := io.ReadAll(mustOpen(t, writer, filepath.Join(providerDir, "1.0.0.json")))
+			if err != nil {
+				t.Fatalf("reading 1.0.0.json: %s", err)
+			}
+			var versionIndex providerMirrorVersionIndex
+			if err := json.Unmarshal(versionData, &versionIndex); err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := versionIndex.Archives["linux_amd64"]; !ok {
+				t.Errorf("1.0.0.json archives = %v; want the linux_amd64 entry", versionIndex.Archives)
+			}
+
+			topData, err := io.ReadAll(mustOpen(t, writer, filepath.Join(providerDir, "index.json")))
+			if err != nil {
+				t.Fatalf("reading index.json: %s", err)
+			}
+			var topIndex providerMirrorIndex
+			if err := json.Unmarshal(topData, &topIndex); err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := topIndex.Versions["1.0.0"]; !ok {
+				t.Errorf("index.json versions = %v; want the 1.0.0 entry", topIndex.Versions)
+			}
+		})
+	}
+}
+
+func mustOpen(t *testing.T, writer MirrorWriter, path string) io.ReadCloser {
+	t.Helper()
+	r, err := writer.Open(path)
+	if err != nil {
+		t.Fatalf("Open(%s): %s", path, err)
+	}
+	return r
+}